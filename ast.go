@@ -0,0 +1,117 @@
+package gotcl
+
+import (
+	"os"
+	"strings"
+)
+
+func (c *Command) Words() []TclTok { return c.words }
+
+func (s *subcommand) Cmd() *Command { return &s.cmd }
+
+func (b *block) Text() string { return b.strval }
+
+func (b *block) AsCmds() ([]Command, os.Error) {
+	if b.cmdsval == nil {
+		c, e := ParseCommands(strings.NewReader(b.strval))
+		if e != nil {
+			return nil, e
+		}
+		b.cmdsval = c
+	}
+	return b.cmdsval, nil
+}
+
+func (l *tliteral) Value() string { return l.strval }
+
+func (e *expandTok) Subject() TclTok { return e.subject }
+
+func (v varRef) Name() string { return v.name }
+
+func (v varRef) IsGlobal() bool { return v.is_global }
+
+func (v varRef) Index() TclTok { return v.arrind }
+
+// Visitor is the go/ast-style interface for walking a parsed AST.
+type Visitor interface {
+	Visit(node interface{}) (w Visitor)
+}
+
+// Walk descends depth-first into node, calling v.Visit along the way.
+func Walk(v Visitor, node interface{}) {
+	v = v.Visit(node)
+	if v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case Command:
+		for _, w := range n.words {
+			Walk(v, w)
+		}
+	case *Command:
+		for _, w := range n.words {
+			Walk(v, w)
+		}
+	case *subcommand:
+		Walk(v, &n.cmd)
+	case *block:
+		if cmds, e := n.AsCmds(); e == nil {
+			for i := range cmds {
+				Walk(v, &cmds[i])
+			}
+		}
+	case *tliteral:
+	case strlit:
+		for _, tok := range n.toks {
+			switch tok.kind {
+			case kSubcmd:
+				Walk(v, tok.subcmd)
+			case kVar:
+				Walk(v, tok.varref)
+			}
+		}
+	case varRef:
+		if n.arrind != nil {
+			Walk(v, n.arrind)
+		}
+	case *varRef:
+		if n.arrind != nil {
+			Walk(v, n.arrind)
+		}
+	case *expandTok:
+		Walk(v, n.subject)
+	}
+	v.Visit(nil)
+}
+
+// Rewrite applies fn bottom-up to node and the tokens it contains. A *block
+// is passed to fn whole: unlike Walk, Rewrite does not descend into its body.
+func Rewrite(node TclTok, fn func(TclTok) TclTok) TclTok {
+	switch n := node.(type) {
+	case *subcommand:
+		for i, w := range n.cmd.words {
+			n.cmd.words[i] = Rewrite(w, fn)
+		}
+	case *expandTok:
+		n.subject = Rewrite(n.subject, fn)
+	case strlit:
+		for i, tok := range n.toks {
+			switch tok.kind {
+			case kSubcmd:
+				n.toks[i].subcmd = Rewrite(tok.subcmd, fn).(*subcommand)
+			case kVar:
+				n.toks[i].varref = Rewrite(tok.varref, fn).(*varRef)
+			}
+		}
+	case *varRef:
+		if n.arrind != nil {
+			n.arrind = Rewrite(n.arrind, fn)
+		}
+	case varRef:
+		if n.arrind != nil {
+			n.arrind = Rewrite(n.arrind, fn)
+		}
+		node = n
+	}
+	return fn(node)
+}
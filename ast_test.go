@@ -0,0 +1,51 @@
+package gotcl
+
+import (
+	"strings"
+	"testing"
+)
+
+type litCounter struct{ n int }
+
+func (c *litCounter) Visit(node interface{}) Visitor {
+	if _, ok := node.(*tliteral); ok {
+		c.n++
+	}
+	return c
+}
+
+func TestWalkDescendsIntoArrayIndex(t *testing.T) {
+	cmds, err := ParseCommands(strings.NewReader("puts $arr(1)"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(cmds) != 1 {
+		t.Fatalf("expected 1 command, got %d", len(cmds))
+	}
+	c := &litCounter{}
+	Walk(c, &cmds[0])
+	if c.n != 2 {
+		t.Errorf("expected Walk to visit 2 literals (\"puts\" and the array index), got %d", c.n)
+	}
+}
+
+func TestRewriteDescendsIntoBareVarRefIndex(t *testing.T) {
+	cmds, err := ParseCommands(strings.NewReader("puts $arr(old)"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	word := cmds[0].Words()[1]
+	if _, ok := word.(varRef); !ok {
+		t.Fatalf("expected a bare varRef word, got %T", word)
+	}
+	visitedIndex := false
+	Rewrite(word, func(tok TclTok) TclTok {
+		if lit, ok := tok.(*tliteral); ok && lit.Value() == "old" {
+			visitedIndex = true
+		}
+		return tok
+	})
+	if !visitedIndex {
+		t.Errorf("Rewrite did not descend into the array index of a bare varRef")
+	}
+}
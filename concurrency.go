@@ -0,0 +1,236 @@
+package gotcl
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+)
+
+type tclChan struct {
+	ch     chan *TclObj
+	closed bool
+}
+
+// Fork gives "go" a child Interp with its own stack (a fresh global frame
+// copied from this one) that can safely run in a new goroutine.
+func (i *Interp) Fork() *Interp {
+	global := i.frame
+	for global.next != nil {
+		global = global.next
+	}
+	vars := make(VarMap, len(global.vars))
+	for n, v := range global.vars {
+		vars[n] = &varEntry{obj: v.obj} // fresh entry: don't alias the parent's
+	}
+	procs := make(map[string]*procDef, len(i.procs))
+	for n, p := range i.procs {
+		procs[n] = p
+	}
+	return &Interp{
+		cmds:     i.cmds,
+		cmdMu:    i.cmdMu,
+		chans:    i.chans,
+		frame:    &stackframe{vars: vars},
+		tchans:   i.tchans,
+		tchanMu:  i.tchanMu,
+		tchanSeq: i.tchanSeq,
+		procs:    procs,
+	}
+}
+
+func tclGo(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 1 {
+		return i.FailStr("wrong # args: should be \"go script\"")
+	}
+	cmds, e := args[0].AsCmds()
+	if e != nil {
+		return i.Fail(e)
+	}
+	child := i.Fork()
+	go child.eval(cmds)
+	return i.Return(kNil)
+}
+
+func (i *Interp) newTclChan(bufsize int) string {
+	i.tchanMu.Lock()
+	defer i.tchanMu.Unlock()
+	*i.tchanSeq++
+	name := "chan" + strconv.Itoa(*i.tchanSeq)
+	i.tchans[name] = &tclChan{ch: make(chan *TclObj, bufsize)}
+	return name
+}
+
+func (i *Interp) getTclChan(name string) (*tclChan, os.Error) {
+	i.tchanMu.Lock()
+	defer i.tchanMu.Unlock()
+	c, ok := i.tchans[name]
+	if !ok {
+		return nil, os.NewError("can not find channel named \"" + name + "\"")
+	}
+	return c, nil
+}
+
+// copyForSend gives the receiving goroutine its own TclObj instead of one
+// that still aliases this goroutine's copy.
+func (t *TclObj) copyForSend() *TclObj {
+	return FromStr(t.AsString())
+}
+
+func tclChan_(i *Interp, args []*TclObj) TclStatus {
+	if len(args) == 0 {
+		return i.FailStr("wrong # args: should be \"chan subcommand ?arg ...?\"")
+	}
+	switch args[0].AsString() {
+	case "create":
+		bufsize := 0
+		if len(args) > 1 {
+			n, e := args[1].AsInt()
+			if e != nil {
+				return i.Fail(e)
+			}
+			bufsize = n
+		}
+		return i.Return(FromStr(i.newTclChan(bufsize)))
+	case "send":
+		if len(args) != 3 {
+			return i.FailStr("wrong # args: should be \"chan send chanId value\"")
+		}
+		c, e := i.getTclChan(args[1].AsString())
+		if e != nil {
+			return i.Fail(e)
+		}
+		i.tchanMu.Lock()
+		if c.closed {
+			i.tchanMu.Unlock()
+			return i.FailStr("can not send on closed channel \"" + args[1].AsString() + "\"")
+		}
+		i.tchanMu.Unlock()
+		c.ch <- args[2].copyForSend()
+		return i.Return(kNil)
+	case "recv":
+		if len(args) != 2 {
+			return i.FailStr("wrong # args: should be \"chan recv chanId\"")
+		}
+		c, e := i.getTclChan(args[1].AsString())
+		if e != nil {
+			return i.Fail(e)
+		}
+		v, ok := <-c.ch
+		if !ok {
+			return i.Return(kNil)
+		}
+		return i.Return(v)
+	case "close":
+		if len(args) != 2 {
+			return i.FailStr("wrong # args: should be \"chan close chanId\"")
+		}
+		c, e := i.getTclChan(args[1].AsString())
+		if e != nil {
+			return i.Fail(e)
+		}
+		i.tchanMu.Lock()
+		if c.closed {
+			i.tchanMu.Unlock()
+			return i.FailStr("channel \"" + args[1].AsString() + "\" is already closed")
+		}
+		c.closed = true
+		close(c.ch)
+		i.tchanMu.Unlock()
+		return i.Return(kNil)
+	}
+	return i.FailStr("unknown chan subcommand: \"" + args[0].AsString() + "\"")
+}
+
+type selectArm struct {
+	chanName  string
+	varName   string
+	body      *TclObj
+	isDefault bool
+}
+
+func parseSelectArms(words []*TclObj) ([]selectArm, os.Error) {
+	arms := make([]selectArm, 0, len(words)/4)
+	for ix := 0; ix < len(words); {
+		if words[ix].AsString() == "default" {
+			if ix+1 >= len(words) {
+				return nil, os.NewError("select: \"default\" needs a body")
+			}
+			arms = append(arms, selectArm{isDefault: true, body: words[ix+1]})
+			ix += 2
+			continue
+		}
+		if ix+3 >= len(words) || words[ix+1].AsString() != "->" {
+			return nil, os.NewError("select: expected \"chan -> var body\"")
+		}
+		arms = append(arms, selectArm{
+			chanName: words[ix].AsString(),
+			varName:  words[ix+2].AsString(),
+			body:     words[ix+3],
+		})
+		ix += 4
+	}
+	if len(arms) == 0 {
+		return nil, os.NewError("select: no arms")
+	}
+	ndefault := 0
+	for _, a := range arms {
+		if a.isDefault {
+			ndefault++
+		}
+	}
+	if ndefault > 1 {
+		return nil, os.NewError("select: at most one \"default\" arm is allowed")
+	}
+	return arms, nil
+}
+
+func tclSelect(i *Interp, args []*TclObj) TclStatus {
+	if len(args) != 1 {
+		return i.FailStr("wrong # args: should be \"select arms\"")
+	}
+	words, e := args[0].AsList()
+	if e != nil {
+		return i.Fail(e)
+	}
+	arms, e := parseSelectArms(words)
+	if e != nil {
+		return i.Fail(e)
+	}
+
+	cases := make([]reflect.SelectCase, 0, len(arms))
+	caseArms := make([]selectArm, 0, len(arms))
+	for _, a := range arms {
+		if a.isDefault {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+			caseArms = append(caseArms, a)
+			continue
+		}
+		c, e := i.getTclChan(a.chanName)
+		if e != nil {
+			return i.Fail(e)
+		}
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.ch)})
+		caseArms = append(caseArms, a)
+	}
+
+	chosen, recv, recvOK := reflect.Select(cases)
+	a := caseArms[chosen]
+	if a.isDefault {
+		cmds, e := a.body.AsCmds()
+		if e != nil {
+			return i.Fail(e)
+		}
+		return i.eval(cmds)
+	}
+
+	val := kNil
+	if recvOK {
+		val = recv.Interface().(*TclObj)
+	}
+	i.SetVarRaw(a.varName, val)
+	cmds, e := a.body.AsCmds()
+	if e != nil {
+		return i.Fail(e)
+	}
+	return i.eval(cmds)
+}
@@ -0,0 +1,104 @@
+package gotcl
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestForkDoesNotAliasParentVars(t *testing.T) {
+	i := NewInterp()
+	i.SetVarRaw("x", FromStr("1"))
+	child := i.Fork()
+	child.SetVarRaw("x", FromStr("2"))
+	v, e := i.GetVarRaw("x")
+	if e != nil {
+		t.Fatalf("GetVarRaw: %v", e)
+	}
+	if v.AsString() != "1" {
+		t.Errorf("parent's x was mutated by a write through the forked child: got %q", v.AsString())
+	}
+}
+
+func TestForkCopiesProcs(t *testing.T) {
+	i := NewInterp()
+	i.procs["greet"] = &procDef{sig: FromStr(""), body: FromStr("")}
+	child := i.Fork()
+	if _, ok := child.procs["greet"]; !ok {
+		t.Errorf("Fork did not copy the parent's procs")
+	}
+}
+
+func TestConcurrentSetCmdDoesNotRace(t *testing.T) {
+	i := NewInterp()
+	var wg sync.WaitGroup
+	for n := 0; n < 20; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			name := "proc" + strconv.Itoa(n)
+			i.SetCmd(name, func(ni *Interp, args []*TclObj) TclStatus { return ni.Return(kNil) })
+		}(n)
+	}
+	wg.Wait()
+}
+
+func TestChanSendRecvRoundTrip(t *testing.T) {
+	i := NewInterp()
+	name := i.newTclChan(1)
+	if rc := tclChan_(i, []*TclObj{FromStr("send"), FromStr(name), FromStr("hello")}); rc != kTclOK {
+		t.Fatalf("send failed: %v", i.err)
+	}
+	rc := tclChan_(i, []*TclObj{FromStr("recv"), FromStr(name)})
+	if rc != kTclOK {
+		t.Fatalf("recv failed: %v", i.err)
+	}
+	if i.retval.AsString() != "hello" {
+		t.Errorf("got %q, want \"hello\"", i.retval.AsString())
+	}
+}
+
+func TestChanDoubleCloseFails(t *testing.T) {
+	i := NewInterp()
+	name := i.newTclChan(0)
+	if rc := tclChan_(i, []*TclObj{FromStr("close"), FromStr(name)}); rc != kTclOK {
+		t.Fatalf("first close failed: %v", i.err)
+	}
+	if rc := tclChan_(i, []*TclObj{FromStr("close"), FromStr(name)}); rc != kTclErr {
+		t.Errorf("expected an error closing an already-closed channel, got status %v", rc)
+	}
+}
+
+func TestChanSendAfterCloseFails(t *testing.T) {
+	i := NewInterp()
+	name := i.newTclChan(1)
+	tclChan_(i, []*TclObj{FromStr("close"), FromStr(name)})
+	rc := tclChan_(i, []*TclObj{FromStr("send"), FromStr(name), FromStr("x")})
+	if rc != kTclErr {
+		t.Errorf("expected an error sending on a closed channel, got status %v", rc)
+	}
+}
+
+func TestSelectRejectsZeroArms(t *testing.T) {
+	i := NewInterp()
+	if rc := tclSelect(i, []*TclObj{FromStr("")}); rc != kTclErr {
+		t.Errorf("expected an error for a select with no arms, got status %v", rc)
+	}
+}
+
+func TestSelectRejectsMultipleDefaults(t *testing.T) {
+	i := NewInterp()
+	arms := FromStr("default {} default {}")
+	if rc := tclSelect(i, []*TclObj{arms}); rc != kTclErr {
+		t.Errorf("expected an error for a select with two default arms, got status %v", rc)
+	}
+}
+
+func TestSelectFallsBackToDefault(t *testing.T) {
+	i := NewInterp()
+	chanName := i.newTclChan(0)
+	arms := FromStr(chanName + " -> v {} default {}")
+	if rc := tclSelect(i, []*TclObj{arms}); rc != kTclOK {
+		t.Errorf("expected the default arm to fire when no channel is ready, got status %v (%v)", rc, i.err)
+	}
+}
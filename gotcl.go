@@ -7,6 +7,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 
@@ -18,6 +19,7 @@ func (ne notExpand) IsExpand() bool {
 
 type tliteral struct {
 	notExpand
+	SrcPos
 	strval string
 	tval   *TclObj
 }
@@ -33,6 +35,7 @@ func (l *tliteral) Eval(i *Interp) TclStatus {
 
 type subcommand struct {
 	notExpand
+	SrcPos
 	cmd Command
 }
 
@@ -43,8 +46,10 @@ func (s *subcommand) Eval(i *Interp) TclStatus {
 
 type block struct {
 	notExpand
-	strval string
-	tval   *TclObj
+	SrcPos
+	strval  string
+	tval    *TclObj
+	cmdsval []Command
 }
 
 func (b *block) String() string { return "{" + b.strval + "}" }
@@ -57,6 +62,7 @@ func (b *block) Eval(i *Interp) TclStatus {
 }
 
 type expandTok struct {
+	SrcPos
 	subject TclTok
 }
 
@@ -74,6 +80,7 @@ func (e *expandTok) String() string {
 
 type strlit struct {
 	notExpand
+	SrcPos
 	toks []littok
 }
 
@@ -107,6 +114,7 @@ func (t strlit) Eval(i *Interp) TclStatus {
 
 type varRef struct {
 	notExpand
+	SrcPos
 	is_global bool
 	name      string
 	arrind    TclTok
@@ -146,6 +154,7 @@ func toVarRef(s string) varRef {
 }
 
 type Command struct {
+	SrcPos
 	words []TclTok
 }
 
@@ -230,10 +239,32 @@ func (s *stackframe) up() *stackframe { return s.next }
 
 type Interp struct {
 	cmds   map[string]TclCmd
+	cmdMu  *sync.Mutex // guards cmds, which is shared across forks (see Fork)
 	chans  map[string]interface{}
 	frame  *stackframe
 	retval *TclObj
 	err    os.Error
+	errTrace []string
+
+	// tchans, tchanMu and tchanSeq back the "chan"/"select" commands. They
+	// are shared (not copied) across an Interp and every Interp forked from
+	// it via Fork, so goroutines started with "go" can talk to one another.
+	tchans  map[string]*tclChan
+	tchanMu *sync.Mutex
+	tchanSeq *int
+
+	// procs records, for every user-defined proc, the source it was
+	// declared with -- so Snapshot can persist procs as source rather than
+	// as the compiled TclCmd closure makeProc builds from them.
+	procs map[string]*procDef
+}
+
+// procDef is the source form of a "proc" definition: the raw arg-list
+// object and body passed to "proc", kept alongside the compiled TclCmd
+// that tclProc installs.
+type procDef struct {
+	sig  *TclObj
+	body *TclObj
 }
 
 func (i *Interp) Return(val *TclObj) TclStatus {
@@ -243,6 +274,7 @@ func (i *Interp) Return(val *TclObj) TclStatus {
 
 func (i *Interp) Fail(err os.Error) TclStatus {
 	i.err = err
+	i.errTrace = nil
 	return kTclErr
 }
 
@@ -250,6 +282,25 @@ func (i *Interp) FailStr(msg string) TclStatus {
 	return i.Fail(os.NewError(msg))
 }
 
+// traceError records the command a failure is currently unwinding through,
+// building up a Tcl-style errorInfo stack as the error propagates outward.
+func (i *Interp) traceError(cmd Command) {
+	i.errTrace = append(i.errTrace, "    (\""+cmd.String()+"\", "+cmd.SrcPos.String()+")")
+}
+
+// ErrorInfo returns the current error message together with the stack of
+// commands it unwound through, in the style of Tcl's errorInfo variable.
+func (i *Interp) ErrorInfo() string {
+	if i.err == nil {
+		return ""
+	}
+	info := i.err.String()
+	for _, frame := range i.errTrace {
+		info += "\n" + frame
+	}
+	return info
+}
+
 type TclObj struct {
 	value      *string
 	intval     int
@@ -479,7 +530,9 @@ func tclProc(i *Interp, args []*TclObj) TclStatus {
 	if err != nil {
 		return i.Fail(err)
 	}
-	i.SetCmd(args[0].AsString(), makeProc(sig, args[2]))
+	name := args[0].AsString()
+	i.SetCmd(name, makeProc(sig, args[2]))
+	i.procs[name] = &procDef{sig: args[1], body: args[2]}
 	return i.Return(kNil)
 }
 
@@ -488,11 +541,16 @@ var tclStdin = bufio.NewReader(os.Stdin)
 func NewInterp() *Interp {
 	i := new(Interp)
 	i.cmds = make(map[string]TclCmd)
+	i.cmdMu = new(sync.Mutex)
 	i.frame = newstackframe(nil)
 	i.chans = make(map[string]interface{})
 	i.chans["stdin"] = tclStdin
 	i.chans["stdout"] = os.Stdout
 	i.chans["stderr"] = os.Stderr
+	i.tchans = make(map[string]*tclChan)
+	i.tchanMu = new(sync.Mutex)
+	i.tchanSeq = new(int)
+	i.procs = make(map[string]*procDef)
 
 	for n, f := range tclBasicCmds {
 		i.SetCmd(n, f)
@@ -500,12 +558,17 @@ func NewInterp() *Interp {
 
 	i.SetCmd("proc", tclProc)
 	i.SetCmd("error", func(ni *Interp, args []*TclObj) TclStatus { return i.FailStr(args[0].AsString()) })
+	i.SetCmd("go", tclGo)
+	i.SetCmd("chan", tclChan_)
+	i.SetCmd("select", tclSelect)
 	return i
 }
 
 type TclCmd func(*Interp, []*TclObj) TclStatus
 
 func (i *Interp) SetCmd(name string, cmd TclCmd) {
+	i.cmdMu.Lock()
+	defer i.cmdMu.Unlock()
 	if cmd == nil {
 		i.cmds[name] = nil, false
 	} else {
@@ -625,16 +688,29 @@ func (i *Interp) evalCmd(cmd Command) TclStatus {
 	}
 	args, rc := evalArgs(i, cmd.words)
 	if rc != kTclOK {
+		if rc == kTclErr {
+			i.traceError(cmd)
+		}
 		return rc
 	}
 	fname := args[0].AsString()
-	if f, ok := i.cmds[fname]; ok {
-		return f(i, args[1:])
+	i.cmdMu.Lock()
+	f, ok := i.cmds[fname]
+	unk, unkOk := i.cmds["unknown"]
+	i.cmdMu.Unlock()
+
+	var rc2 TclStatus
+	if ok {
+		rc2 = f(i, args[1:])
+	} else if unkOk {
+		rc2 = unk(i, args)
+	} else {
+		rc2 = i.FailStr("command not found: " + fname)
 	}
-	if f, ok := i.cmds["unknown"]; ok {
-		return f(i, args)
+	if rc2 == kTclErr {
+		i.traceError(cmd)
 	}
-	return i.FailStr("command not found: " + fname)
+	return rc2
 }
 
 func (i *Interp) EvalString(s string) (*TclObj, os.Error) {
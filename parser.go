@@ -3,6 +3,8 @@ package gotcl
 import (
 	"os"
 	"bytes"
+	"sort"
+	"strconv"
 	"unicode"
 )
 
@@ -10,15 +12,95 @@ type RuneSource interface {
 	ReadRune() (int, int, os.Error)
 }
 
+// SrcPos identifies a location within a parsed script. The parser only
+// ever gets a bare RuneSource and never sets Filename, so it is empty in
+// every parsed position and String prints "<input>" in its place.
+type SrcPos struct {
+	Filename string
+	Line     int
+	Col      int
+}
+
+func (p SrcPos) String() string {
+	name := p.Filename
+	if name == "" {
+		name = "<input>"
+	}
+	return name + ":" + strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Col)
+}
+
+// Error is a single parse failure at a known position, modeled after
+// go/scanner.Error.
+type Error struct {
+	Pos SrcPos
+	Msg string
+}
+
+func (e *Error) String() string { return e.Pos.String() + ": " + e.Msg }
+
+// ErrorList collects every parse failure found in one pass over a script,
+// in the order they were recorded. It implements os.Error and
+// sort.Interface so callers can report all of them at once, sorted by
+// position, instead of aborting at the first one.
+type ErrorList []*Error
+
+func (el ErrorList) Len() int      { return len(el) }
+func (el ErrorList) Swap(i, j int) { el[i], el[j] = el[j], el[i] }
+func (el ErrorList) Less(i, j int) bool {
+	if el[i].Pos.Line != el[j].Pos.Line {
+		return el[i].Pos.Line < el[j].Pos.Line
+	}
+	return el[i].Pos.Col < el[j].Pos.Col
+}
+
+func (el *ErrorList) Add(pos SrcPos, msg string) {
+	*el = append(*el, &Error{Pos: pos, Msg: msg})
+}
+
+// AddError records e, preserving its position if it already carries one.
+func (el *ErrorList) AddError(e os.Error) {
+	if pe, ok := e.(*Error); ok {
+		*el = append(*el, pe)
+		return
+	}
+	*el = append(*el, &Error{Msg: e.String()})
+}
+
+func (el ErrorList) Sort() { sort.Sort(el) }
+
+func (el ErrorList) String() string {
+	switch len(el) {
+	case 0:
+		return "no errors"
+	case 1:
+		return el[0].String()
+	}
+	return el[0].String() + " (and " + strconv.Itoa(len(el)-1) + " more errors)"
+}
+
 type parser struct {
 	data   RuneSource
 	tmpbuf *bytes.Buffer
 	ch     int
+	pos    SrcPos
 }
 
 func newParser(input RuneSource) *parser {
-	p := &parser{data: input, tmpbuf: bytes.NewBuffer(make([]byte, 0, 1024))}
-	p.advance()
+	p := &parser{
+		data:   input,
+		tmpbuf: bytes.NewBuffer(make([]byte, 0, 1024)),
+		pos:    SrcPos{Line: 1, Col: 1},
+	}
+	// Prime p.ch directly instead of going through advance(): advance()
+	// reports the *previous* p.ch and advances pos past it, and there is
+	// no previous rune yet here. Priming through it would count the zero
+	// value of p.ch as a consumed character and misalign every SrcPos.
+	r, _, e := p.data.ReadRune()
+	if e != nil {
+		p.ch = -1
+	} else {
+		p.ch = r
+	}
 	return p
 }
 
@@ -27,64 +109,132 @@ func isvarword(c int) bool {
 	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'
 }
 
-func (p *parser) fail(s string) {
-	panic(os.NewError(s))
+// errorAt builds a position-carrying error rooted at the parser's current
+// location, so callers can report exactly where a script went wrong.
+func (p *parser) errorAt(s string) os.Error {
+	return &Error{Pos: p.pos, Msg: s}
 }
 
-func (p *parser) advance() (result int) {
+// resync skips forward to the next command boundary (a ';' or '\n' outside
+// any {}, [] or () nesting) so parsing can continue after a recoverable
+// syntax error instead of aborting the whole script.
+func (p *parser) resync() {
+	depth := 0
+	for p.ch != -1 {
+		if depth == 0 && isEol(p.ch) {
+			return
+		}
+		switch p.ch {
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			if depth > 0 {
+				depth--
+			}
+		}
+		if _, e := p.advance(); e != nil {
+			return
+		}
+	}
+}
+
+// resyncList is resync's list-parsing counterpart: a list element has no
+// ';'/'\n' terminator, so it skips to the next whitespace (outside any
+// {}/[]/() nesting) instead of the next command boundary.
+func (p *parser) resyncList() {
+	depth := 0
+	for p.ch != -1 {
+		if depth == 0 && unicode.IsSpace(p.ch) {
+			return
+		}
+		switch p.ch {
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			if depth > 0 {
+				depth--
+			}
+		}
+		if _, e := p.advance(); e != nil {
+			return
+		}
+	}
+}
+
+// advance returns the rune under the cursor and moves past it, tracking
+// line/column as it goes. It reports an error on unexpected EOF or on a
+// failure from the underlying RuneSource.
+func (p *parser) advance() (result int, err os.Error) {
 	if p.ch == -1 {
-		p.fail("unexpected EOF")
+		return 0, p.errorAt("unexpected EOF")
 	}
 	result = p.ch
+	if result == '\n' {
+		p.pos.Line++
+		p.pos.Col = 1
+	} else {
+		p.pos.Col++
+	}
 	r, _, e := p.data.ReadRune()
 	if e != nil {
 		if e != os.EOF {
-			p.fail(e.String())
+			return result, p.errorAt(e.String())
 		}
 		p.ch = -1
 	} else {
 		p.ch = r
 	}
-	return
+	return result, nil
 }
 
-func (p *parser) consumeWhile1(fn func(int) bool, desc string) string {
+func (p *parser) consumeWhile1(fn func(int) bool, desc string) (string, os.Error) {
 	p.tmpbuf.Reset()
 	for p.ch != -1 && fn(p.ch) {
-		p.tmpbuf.WriteRune(p.advance())
+		c, e := p.advance()
+		if e != nil {
+			return "", e
+		}
+		p.tmpbuf.WriteRune(c)
 	}
 	res := p.tmpbuf.String()
 	if res == "" {
-		p.expectFailed(desc, p.ch)
+		return "", p.expectFailed(desc, p.ch)
 	}
-	return res
+	return res, nil
 }
 
-func (p *parser) expectFailed(expected string, ch int) {
+func (p *parser) expectFailed(expected string, ch int) os.Error {
 	got := "EOF"
 	if ch != -1 {
 		got = string(ch)
 	}
-	p.fail("Expected " + expected + ", got '" + got + "'")
+	return p.errorAt("Expected " + expected + ", got '" + got + "'")
 }
 
-func (p *parser) consumeRune(rune int) {
+func (p *parser) consumeRune(rune int) os.Error {
 	if p.ch != rune {
-		p.expectFailed("'"+string(rune)+"'", p.ch)
+		return p.expectFailed("'"+string(rune)+"'", p.ch)
 	}
-	p.advance()
+	_, e := p.advance()
+	return e
 }
 
-func (p *parser) eatSpace() {
+func (p *parser) eatSpace() os.Error {
 	for p.ch != -1 && unicode.IsSpace(p.ch) {
-		p.advance()
+		if _, e := p.advance(); e != nil {
+			return e
+		}
 	}
+	return nil
 }
 
-func (p *parser) eatWhile(fn func(int) bool) {
+func (p *parser) eatWhile(fn func(int) bool) os.Error {
 	for p.ch != -1 && fn(p.ch) {
-		p.advance()
+		if _, e := p.advance(); e != nil {
+			return e
+		}
 	}
+	return nil
 }
 
 func isword(c int) bool {
@@ -94,15 +244,22 @@ func isword(c int) bool {
 	}
 	return !unicode.IsSpace(c)
 }
-func (p *parser) parseSimpleWordTil(til int) *tliteral {
+
+func (p *parser) parseSimpleWordTil(til int) (*tliteral, os.Error) {
+	startPos := p.pos
 	p.tmpbuf.Reset()
 	prev_esc := false
 	for p.ch != -1 && p.ch != til {
 		if p.ch == '\\' && !prev_esc {
 			prev_esc = true
-			p.advance()
+			if _, e := p.advance(); e != nil {
+				return nil, e
+			}
 		} else if prev_esc || isword(p.ch) {
-			c := p.advance()
+			c, e := p.advance()
+			if e != nil {
+				return nil, e
+			}
 			if prev_esc {
 				p.tmpbuf.WriteString(escaped(c))
 				prev_esc = false
@@ -115,95 +272,160 @@ func (p *parser) parseSimpleWordTil(til int) *tliteral {
 	}
 	res := p.tmpbuf.String()
 	if len(res) == 0 {
-		p.expectFailed("word", p.ch)
+		return nil, p.expectFailed("word", p.ch)
 	}
-	return &tliteral{strval: res}
+	return &tliteral{SrcPos: startPos, strval: res}, nil
 }
 
-func (p *parser) parseSubcommand() *subcommand {
-	p.consumeRune('[')
+func (p *parser) parseSubcommand() (*subcommand, os.Error) {
+	startPos := p.pos
+	if e := p.consumeRune('['); e != nil {
+		return nil, e
+	}
 	res := make([]TclTok, 0, 16)
-	p.eatWhile(issepspace)
+	if e := p.eatWhile(issepspace); e != nil {
+		return nil, e
+	}
 	for p.ch != ']' {
-		appendttok(&res, p.parseToken())
-		p.eatWhile(issepspace)
+		tok, e := p.parseToken()
+		if e != nil {
+			return nil, e
+		}
+		appendttok(&res, tok)
+		if e := p.eatWhile(issepspace); e != nil {
+			return nil, e
+		}
 	}
-	p.consumeRune(']')
-	return &subcommand{cmd: Command{res}}
+	if e := p.consumeRune(']'); e != nil {
+		return nil, e
+	}
+	return &subcommand{SrcPos: startPos, cmd: Command{SrcPos: startPos, words: res}}, nil
 }
 
-func (p *parser) parseBlockData() string {
-	p.consumeRune('{')
+func (p *parser) parseBlockData() (string, os.Error) {
+	if e := p.consumeRune('{'); e != nil {
+		return "", e
+	}
 	nest := 0
 	p.tmpbuf.Reset()
 	for {
 		switch p.ch {
 		case '\\':
-			p.tmpbuf.WriteRune(p.advance())
+			c, e := p.advance()
+			if e != nil {
+				return "", e
+			}
+			p.tmpbuf.WriteRune(c)
 		case '{':
 			nest++
 		case '}':
 			if nest == 0 {
-				p.advance()
-				return p.tmpbuf.String()
+				if _, e := p.advance(); e != nil {
+					return "", e
+				}
+				return p.tmpbuf.String(), nil
 			}
 			nest--
 		case -1:
-			p.fail("unclosed block")
+			return "", p.errorAt("unclosed block")
+		}
+		c, e := p.advance()
+		if e != nil {
+			return "", e
 		}
-		p.tmpbuf.WriteRune(p.advance())
+		p.tmpbuf.WriteRune(c)
 	}
-	return "" // never happens.
+	panic("unreachable")
 }
 
 func (p *parser) hasExtraChars() bool {
 	return p.ch != -1 && !unicode.IsSpace(p.ch) && p.ch != '}' && p.ch != ']'
 }
 
-func (p *parser) checkForExtraChars() {
+func (p *parser) checkForExtraChars() os.Error {
 	if p.hasExtraChars() {
-		p.fail("extra characters after close-brace")
+		return p.errorAt("extra characters after close-brace")
 	}
+	return nil
 }
 
-func (p *parser) parseBlock() *block {
-	bd := p.parseBlockData()
-	p.checkForExtraChars()
-	return &block{strval: bd}
+func (p *parser) parseBlock() (*block, os.Error) {
+	startPos := p.pos
+	bd, e := p.parseBlockData()
+	if e != nil {
+		return nil, e
+	}
+	if e := p.checkForExtraChars(); e != nil {
+		return nil, e
+	}
+	return &block{SrcPos: startPos, strval: bd}, nil
 }
 
-func (p *parser) parseBlockOrExpand() TclTok {
-	bd := p.parseBlockData()
+func (p *parser) parseBlockOrExpand() (TclTok, os.Error) {
+	startPos := p.pos
+	bd, e := p.parseBlockData()
+	if e != nil {
+		return nil, e
+	}
 	if bd == "*" && p.hasExtraChars() {
-		return &expandTok{p.parseToken()}
+		tok, e := p.parseToken()
+		if e != nil {
+			return nil, e
+		}
+		return &expandTok{SrcPos: startPos, subject: tok}, nil
 	}
-	p.checkForExtraChars()
-	return &block{strval: bd}
+	if e := p.checkForExtraChars(); e != nil {
+		return nil, e
+	}
+	return &block{SrcPos: startPos, strval: bd}, nil
 }
 
-func (p *parser) parseVariable() varRef {
-	p.consumeRune('$')
+func (p *parser) parseVariable() (varRef, os.Error) {
+	if e := p.consumeRune('$'); e != nil {
+		return varRef{}, e
+	}
 	return p.parseVarRef()
 }
 
-func (p *parser) parseVarRef() varRef {
+func (p *parser) parseVarRef() (varRef, os.Error) {
+	startPos := p.pos
 	if p.ch == '{' {
-		return toVarRef(p.parseBlockData())
+		bd, e := p.parseBlockData()
+		if e != nil {
+			return varRef{}, e
+		}
+		vr := toVarRef(bd)
+		vr.SrcPos = startPos
+		return vr, nil
 	}
 	global := false
 	if p.ch == ':' {
-		p.advance()
-		p.consumeRune(':')
+		if _, e := p.advance(); e != nil {
+			return varRef{}, e
+		}
+		if e := p.consumeRune(':'); e != nil {
+			return varRef{}, e
+		}
 		global = true
 	}
-	name := p.consumeWhile1(isvarword, "variable name")
+	name, e := p.consumeWhile1(isvarword, "variable name")
+	if e != nil {
+		return varRef{}, e
+	}
 	var ind TclTok
 	if p.ch == '(' {
-		p.advance()
-		ind = p.parseTokenTil(')')
-		p.consumeRune(')')
+		if _, e := p.advance(); e != nil {
+			return varRef{}, e
+		}
+		ind, e = p.parseTokenTil(')')
+		if e != nil {
+			return varRef{}, e
+		}
+		if e := p.consumeRune(')'); e != nil {
+			return varRef{}, e
+		}
 	}
-	return varRef{is_global: global, name: name, arrind: ind}
+	return varRef{SrcPos: startPos, is_global: global, name: name, arrind: ind}, nil
 }
 
 func appendtok(tx *[]littok, t littok) {
@@ -228,8 +450,11 @@ func escaped(r int) string {
 	return string(r)
 }
 
-func (p *parser) parseStringLit() strlit {
-	p.consumeRune('"')
+func (p *parser) parseStringLit() (strlit, os.Error) {
+	startPos := p.pos
+	if e := p.consumeRune('"'); e != nil {
+		return strlit{}, e
+	}
 	var accum bytes.Buffer
 	toks := make([]littok, 0, 8)
 	record_accum := func() {
@@ -242,23 +467,41 @@ func (p *parser) parseStringLit() strlit {
 		switch p.ch {
 		case '"':
 			record_accum()
-			p.advance()
-			return strlit{toks: toks}
+			if _, e := p.advance(); e != nil {
+				return strlit{}, e
+			}
+			return strlit{SrcPos: startPos, toks: toks}, nil
 		case '$':
 			record_accum()
-			vref := p.parseVariable()
+			vref, e := p.parseVariable()
+			if e != nil {
+				return strlit{}, e
+			}
 			appendtok(&toks, littok{kind: kVar, varref: &vref})
 		case '[':
 			record_accum()
-			subcmd := p.parseSubcommand()
+			subcmd, e := p.parseSubcommand()
+			if e != nil {
+				return strlit{}, e
+			}
 			appendtok(&toks, littok{kind: kSubcmd, subcmd: subcmd})
 		case '\\':
-			p.advance()
-			accum.WriteString(escaped(p.advance()))
+			if _, e := p.advance(); e != nil {
+				return strlit{}, e
+			}
+			c, e := p.advance()
+			if e != nil {
+				return strlit{}, e
+			}
+			accum.WriteString(escaped(c))
 		case -1:
-			p.fail("Unexpected EOF, wanted \"")
+			return strlit{}, p.errorAt("Unexpected EOF, wanted \"")
 		default:
-			accum.WriteRune(p.advance())
+			c, e := p.advance()
+			if e != nil {
+				return strlit{}, e
+			}
+			accum.WriteRune(c)
 		}
 	}
 	panic("unreachable")
@@ -272,17 +515,26 @@ func isEol(ch int) bool {
 	return false
 }
 
-func (p *parser) eatExtra() {
-	p.eatSpace()
+func (p *parser) eatExtra() os.Error {
+	if e := p.eatSpace(); e != nil {
+		return e
+	}
 	for p.ch == ';' {
-		p.advance()
-		p.eatSpace()
+		if _, e := p.advance(); e != nil {
+			return e
+		}
+		if e := p.eatSpace(); e != nil {
+			return e
+		}
 	}
+	return nil
 }
 
-func (p *parser) parseComment() {
-	p.consumeRune('#')
-	p.eatWhile(func(c int) bool { return c != '\n' })
+func (p *parser) parseComment() os.Error {
+	if e := p.consumeRune('#'); e != nil {
+		return e
+	}
+	return p.eatWhile(func(c int) bool { return c != '\n' })
 }
 
 func appendcmd(tx *[]Command, t Command) {
@@ -297,18 +549,43 @@ func appendcmd(tx *[]Command, t Command) {
 	(*tx)[oldlen] = t
 }
 
-func (p *parser) parseCommands() []Command {
+func (p *parser) parseCommands() ([]Command, os.Error) {
 	res := make([]Command, 0, 128)
-	p.eatSpace()
+	var errs ErrorList
+	if e := p.eatSpace(); e != nil {
+		errs.AddError(e)
+		return res, finishErrors(errs)
+	}
 	for p.ch != -1 {
 		if p.ch == '#' {
-			p.parseComment()
+			if e := p.parseComment(); e != nil {
+				errs.AddError(e)
+				p.resync()
+			}
 		} else {
-			appendcmd(&res, p.parseCommand())
+			cmd, e := p.parseCommand()
+			if e != nil {
+				errs.AddError(e)
+				p.resync()
+			} else {
+				appendcmd(&res, cmd)
+			}
+		}
+		if e := p.eatExtra(); e != nil {
+			errs.AddError(e)
+			break
 		}
-		p.eatExtra()
 	}
-	return res
+	return res, finishErrors(errs)
+}
+
+// finishErrors sorts and returns errs as an os.Error, or nil if it is empty.
+func finishErrors(errs ErrorList) os.Error {
+	if len(errs) == 0 {
+		return nil
+	}
+	errs.Sort()
+	return errs
 }
 
 func appendttok(tx *[]TclTok, t TclTok) {
@@ -322,47 +599,81 @@ func appendttok(tx *[]TclTok, t TclTok) {
 	(*tx)[oldlen] = t
 }
 
-func (p *parser) parseList() []TclTok {
+func (p *parser) parseList() ([]TclTok, os.Error) {
 	res := make([]TclTok, 0, 32)
+	var errs ErrorList
 	for p.ch != -1 {
-		p.eatSpace()
+		if e := p.eatSpace(); e != nil {
+			errs.AddError(e)
+			break
+		}
 		if p.ch == -1 {
 			break
 		}
-		appendttok(&res, p.parseListToken())
+		tok, e := p.parseListToken()
+		if e != nil {
+			errs.AddError(e)
+			p.resyncList()
+			continue
+		}
+		appendttok(&res, tok)
 	}
-	return res
+	return res, finishErrors(errs)
 }
 
 func notspace(c int) bool { return !unicode.IsSpace(c) }
 
-func (p *parser) parseListToken() TclTok {
-	p.eatSpace()
+func (p *parser) parseListToken() (TclTok, os.Error) {
+	if e := p.eatSpace(); e != nil {
+		return nil, e
+	}
+	startPos := p.pos
 	switch p.ch {
 	case '{':
-		return &tliteral{strval: p.parseBlockData()}
+		bd, e := p.parseBlockData()
+		if e != nil {
+			return nil, e
+		}
+		return &tliteral{SrcPos: startPos, strval: bd}, nil
 	case '"':
 		return p.parseStringLit()
 	}
-	return &tliteral{strval: p.consumeWhile1(notspace, "word")}
+	word, e := p.consumeWhile1(notspace, "word")
+	if e != nil {
+		return nil, e
+	}
+	return &tliteral{SrcPos: startPos, strval: word}, nil
 }
 
-func (p *parser) parseCommand() Command {
+func (p *parser) parseCommand() (Command, os.Error) {
+	startPos := p.pos
 	res := make([]TclTok, 0, 16)
-	appendttok(&res, p.parseToken())
-	p.eatWhile(issepspace)
+	tok, e := p.parseToken()
+	if e != nil {
+		return Command{}, e
+	}
+	appendttok(&res, tok)
+	if e := p.eatWhile(issepspace); e != nil {
+		return Command{}, e
+	}
 	for !isEol(p.ch) {
-		appendttok(&res, p.parseToken())
-		p.eatWhile(issepspace)
+		tok, e := p.parseToken()
+		if e != nil {
+			return Command{}, e
+		}
+		appendttok(&res, tok)
+		if e := p.eatWhile(issepspace); e != nil {
+			return Command{}, e
+		}
 	}
-	return Command{res}
+	return Command{SrcPos: startPos, words: res}, nil
 }
 
-func (p *parser) parseToken() TclTok {
+func (p *parser) parseToken() (TclTok, os.Error) {
 	return p.parseTokenTil(-1)
 }
 
-func (p *parser) parseTokenTil(til int) TclTok {
+func (p *parser) parseTokenTil(til int) (TclTok, os.Error) {
 	switch p.ch {
 	case '[':
 		return p.parseSubcommand()
@@ -376,22 +687,22 @@ func (p *parser) parseTokenTil(til int) TclTok {
 	return p.parseSimpleWordTil(til)
 }
 
-func setError(err *os.Error) {
-	if e := recover(); e != nil {
-		*err = e.(os.Error)
-	}
-}
-
+// ParseList parses in as a Tcl list. On a malformed element it resyncs at
+// the next whitespace boundary and keeps going, so items holds every
+// element that parsed cleanly and err, if non-nil, is an ErrorList
+// describing every failure found along the way.
 func ParseList(in RuneSource) (items []TclTok, err os.Error) {
 	p := newParser(in)
-	defer setError(&err)
-	items = p.parseList()
-	return
+	return p.parseList()
 }
 
+// ParseCommands parses in as a sequence of Tcl commands. On a recoverable
+// syntax error (an unterminated string, extra characters after a closing
+// brace, a malformed $var(...) reference) it resyncs at the next command
+// boundary and keeps going, so cmds holds every command that parsed
+// cleanly and err, if non-nil, is an ErrorList describing every failure
+// found in the one pass.
 func ParseCommands(in RuneSource) (cmds []Command, err os.Error) {
 	p := newParser(in)
-	defer setError(&err)
-	cmds = p.parseCommands()
-	return
+	return p.parseCommands()
 }
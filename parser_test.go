@@ -0,0 +1,39 @@
+package gotcl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCommandsCollectsMultipleErrors(t *testing.T) {
+	src := "set x 1\nputs [oops\nset y 2\n"
+	cmds, err := ParseCommands(strings.NewReader(src))
+	if err == nil {
+		t.Fatalf("expected a parse error")
+	}
+	el, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected an ErrorList, got %T", err)
+	}
+	if len(el) != 1 {
+		t.Errorf("expected 1 recorded error, got %d (%v)", len(el), el)
+	}
+	if len(cmds) != 2 {
+		t.Errorf("expected the 2 valid commands to still parse, got %d", len(cmds))
+	}
+}
+
+func TestParseListRecoversRestOfLineAfterBadElement(t *testing.T) {
+	src := `"text $bad(oops extra" good2 good3`
+	items, err := ParseList(strings.NewReader(src))
+	if err == nil {
+		t.Fatalf("expected a parse error from the malformed $bad( reference")
+	}
+	found := map[string]bool{}
+	for _, it := range items {
+		found[it.String()] = true
+	}
+	if !found["good2"] || !found["good3"] {
+		t.Errorf("parseList lost valid list elements after a bad one: got %v", items)
+	}
+}
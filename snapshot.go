@@ -0,0 +1,100 @@
+package gotcl
+
+import (
+	"gob"
+	"io"
+	"os"
+)
+
+// GobEncode and GobDecode round-trip a TclObj through its string form, so a
+// restored TclObj recomputes its cached fields on demand via FromStr.
+func (t *TclObj) GobEncode() ([]byte, os.Error) {
+	return []byte(t.AsString()), nil
+}
+
+func (t *TclObj) GobDecode(data []byte) os.Error {
+	*t = *FromStr(string(data))
+	return nil
+}
+
+type procSnapshot struct {
+	Sig  *TclObj
+	Body *TclObj
+}
+
+type interpSnapshot struct {
+	Frames []map[string]*TclObj
+	Procs  map[string]procSnapshot
+	Chans  []string
+}
+
+// Snapshot writes i's variable frames, procs and channel names to w for
+// later RestoreInterp. Vars linked via "upvar"/"global" are skipped, since
+// they're aliases of another frame's state rather than their own.
+func (i *Interp) Snapshot(w io.Writer) os.Error {
+	snap := interpSnapshot{
+		Procs: make(map[string]procSnapshot, len(i.procs)),
+		Chans: make([]string, 0, len(i.chans)),
+	}
+	for f := i.frame; f != nil; f = f.next {
+		fvars := make(map[string]*TclObj, len(f.vars))
+		for name, ve := range f.vars {
+			if ve == nil || ve.link != nil {
+				continue
+			}
+			fvars[name] = ve.obj
+		}
+		snap.Frames = append(snap.Frames, fvars)
+	}
+	for name, pd := range i.procs {
+		snap.Procs[name] = procSnapshot{Sig: pd.sig, Body: pd.body}
+	}
+	for name := range i.chans {
+		snap.Chans = append(snap.Chans, name)
+	}
+	return gob.NewEncoder(w).Encode(&snap)
+}
+
+// RestoreInterp rebuilds an Interp from a snapshot written by Snapshot,
+// recompiling procs from their stored source via makeProc.
+func RestoreInterp(r io.Reader) (*Interp, os.Error) {
+	var snap interpSnapshot
+	if e := gob.NewDecoder(r).Decode(&snap); e != nil {
+		return nil, e
+	}
+
+	i := NewInterp()
+
+	for _, name := range snap.Chans {
+		if _, ok := i.chans[name]; !ok {
+			i.chans[name] = nil
+		}
+	}
+
+	if len(snap.Frames) > 0 {
+		frames := make([]*stackframe, len(snap.Frames))
+		for ix := range frames {
+			frames[ix] = newstackframe(nil)
+		}
+		for ix := 0; ix < len(frames)-1; ix++ {
+			frames[ix].next = frames[ix+1]
+		}
+		for ix, fvars := range snap.Frames {
+			for name, obj := range fvars {
+				frames[ix].vars[name] = &varEntry{obj: obj}
+			}
+		}
+		i.frame = frames[0]
+	}
+
+	for name, pd := range snap.Procs {
+		sig, e := pd.Sig.AsList()
+		if e != nil {
+			return nil, e
+		}
+		i.SetCmd(name, makeProc(sig, pd.Body))
+		i.procs[name] = &procDef{sig: pd.Sig, body: pd.Body}
+	}
+
+	return i, nil
+}
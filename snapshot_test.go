@@ -0,0 +1,44 @@
+package gotcl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSnapshotRestoreRoundTripsVarsAndProcs(t *testing.T) {
+	i := NewInterp()
+	i.SetVarRaw("x", FromStr("42"))
+
+	sig, e := FromStr("name").AsList()
+	if e != nil {
+		t.Fatalf("AsList: %v", e)
+	}
+	i.procs["greet"] = &procDef{sig: FromStr("name"), body: FromStr("")}
+	i.SetCmd("greet", makeProc(sig, FromStr("")))
+
+	var buf bytes.Buffer
+	if e := i.Snapshot(&buf); e != nil {
+		t.Fatalf("Snapshot: %v", e)
+	}
+
+	ri, e := RestoreInterp(&buf)
+	if e != nil {
+		t.Fatalf("RestoreInterp: %v", e)
+	}
+
+	v, e := ri.GetVarRaw("x")
+	if e != nil {
+		t.Fatalf("restored interp is missing var \"x\": %v", e)
+	}
+	if v.AsString() != "42" {
+		t.Errorf("got x = %q, want \"42\"", v.AsString())
+	}
+
+	pd, ok := ri.procs["greet"]
+	if !ok {
+		t.Fatalf("restored interp is missing proc \"greet\"")
+	}
+	if pd.sig.AsString() != "name" {
+		t.Errorf("got proc sig %q, want \"name\"", pd.sig.AsString())
+	}
+}